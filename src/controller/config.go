@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigAPIVersion and ConfigKind identify the configuration file format.
+	ConfigAPIVersion = "config.hcp-deployment-controller/v1alpha1"
+	ConfigKind       = "HCPDeploymentControllerConfiguration"
+)
+
+// Config is the versioned configuration of the controller. It is read from the
+// file given with --config; command line flags override the values in it.
+type Config struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Workers is the number of HCPDeployments synced concurrently.
+	Workers int `json:"workers"`
+	// ResyncPeriod is how often the informers resync HCPDeployments.
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// ProbeAddress is the address the readiness endpoint binds to.
+	ProbeAddress string `json:"probeAddress"`
+	// MaxHCPDeployments caps the number of HCPDeployments deployed by this
+	// controller instance. Deployed HCPDeployments are always reconciled;
+	// new ones are refused once the cap is reached. Zero means unlimited.
+	MaxHCPDeployments int `json:"maxHCPDeployments"`
+	// RegistryMirrors maps source registries to the mirrors used in their
+	// place.
+	RegistryMirrors RegistryMirrors `json:"registryMirrors,omitempty"`
+	// RequireRegistryMirror refuses images whose registry has no mirror.
+	RequireRegistryMirror bool `json:"requireRegistryMirror"`
+	// CostLabels are added to every deployed Deployment and pod template.
+	CostLabels CostLabels `json:"costLabels,omitempty"`
+	// LogLevel, when set, overrides the klog verbosity given with -v.
+	LogLevel *int `json:"logLevel,omitempty"`
+}
+
+// NewDefaultConfig returns a Config with every field set to its default.
+func NewDefaultConfig() *Config {
+	return &Config{
+		TypeMeta:          metav1.TypeMeta{APIVersion: ConfigAPIVersion, Kind: ConfigKind},
+		Workers:           2,
+		ResyncPeriod:      metav1.Duration{Duration: 30 * time.Second},
+		ProbeAddress:      ":8081",
+		MaxHCPDeployments: 0,
+		RegistryMirrors:   RegistryMirrors{},
+		CostLabels:        CostLabels{},
+	}
+}
+
+// AddFlags binds the command line flags that override the configuration
+// file to the fields of cfg.
+func (cfg *Config) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "Number of HCPDeployments synced concurrently.")
+	fs.DurationVar(&cfg.ResyncPeriod.Duration, "resync-period", cfg.ResyncPeriod.Duration, "How often the informers resync HCPDeployments.")
+	fs.StringVar(&cfg.ProbeAddress, "probe-address", cfg.ProbeAddress, "The address the readiness endpoint (/readyz) binds to.")
+	fs.IntVar(&cfg.MaxHCPDeployments, "max-hcpdeployments", cfg.MaxHCPDeployments, "Maximum number of HCPDeployments managed by this controller instance. 0 means unlimited.")
+	fs.Var(cfg.RegistryMirrors, "registry-mirror", "Registry mirror in the form source=mirror (e.g. registry.k8s.io=harbor.example.com/k8s). May be repeated.")
+	fs.BoolVar(&cfg.RequireRegistryMirror, "require-registry-mirror", cfg.RequireRegistryMirror, "Refuse to deploy images whose registry has no mirror configured (air-gapped mode).")
+	fs.Var(cfg.CostLabels, "cost-label", "Cost allocation label in the form key=value added to every deployed Deployment and pod template. The value may contain {name} and {namespace} of the HCPDeployment. May be repeated.")
+}
+
+// BuildConfig returns the configuration made of the defaults, the
+// configuration file at path (if path is not empty) and the flags explicitly
+// set in fs, in increasing order of precedence. It is called again on every
+// reload of the configuration file so that flags keep taking precedence.
+func BuildConfig(path string, fs *flag.FlagSet) (*Config, error) {
+	cfg := NewDefaultConfig()
+	if path != "" {
+		if err := LoadConfig(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	overrides := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	cfg.AddFlags(overrides)
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil && overrides.Lookup(f.Name) != nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// LoadConfig reads the configuration file at path on top of cfg. Fields that
+// are not present in the file keep their current value; unknown fields are
+// rejected.
+func LoadConfig(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg.TypeMeta = metav1.TypeMeta{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("failed to decode configuration file %s: %v", path, err)
+	}
+	// A key whose entries are all commented out decodes to a nil map, which
+	// the flags would then fail to write into.
+	if cfg.RegistryMirrors == nil {
+		cfg.RegistryMirrors = RegistryMirrors{}
+	}
+	if cfg.CostLabels == nil {
+		cfg.CostLabels = CostLabels{}
+	}
+	for source, mirror := range cfg.RegistryMirrors {
+		cfg.RegistryMirrors[source] = strings.TrimRight(mirror, "/")
+	}
+	return nil
+}
+
+// Validate returns an error describing every invalid field of cfg.
+func (cfg *Config) Validate() error {
+	var errs field.ErrorList
+	if cfg.APIVersion != ConfigAPIVersion {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), cfg.APIVersion, []string{ConfigAPIVersion}))
+	}
+	if cfg.Kind != ConfigKind {
+		errs = append(errs, field.NotSupported(field.NewPath("kind"), cfg.Kind, []string{ConfigKind}))
+	}
+	if cfg.Workers <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("workers"), cfg.Workers, "must be greater than 0"))
+	}
+	if cfg.ResyncPeriod.Duration <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("resyncPeriod"), cfg.ResyncPeriod.Duration.String(), "must be greater than 0"))
+	}
+	if cfg.MaxHCPDeployments < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("maxHCPDeployments"), cfg.MaxHCPDeployments, "must not be negative"))
+	}
+	if cfg.LogLevel != nil && *cfg.LogLevel < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("logLevel"), *cfg.LogLevel, "must not be negative"))
+	}
+	for source, mirror := range cfg.RegistryMirrors {
+		if source == "" || mirror == "" {
+			errs = append(errs, field.Invalid(field.NewPath("registryMirrors").Key(source), mirror, "source and mirror must not be empty"))
+		}
+	}
+	for key := range cfg.CostLabels {
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(field.NewPath("costLabels").Key(key), key, strings.Join(msgs, "; ")))
+		}
+	}
+	return errs.ToAggregate()
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testConfigFile = `apiVersion: config.hcp-deployment-controller/v1alpha1
+kind: HCPDeploymentControllerConfiguration
+workers: 4
+probeAddress: ":9090"
+registryMirrors:
+  docker.io: harbor.example.com/dockerhub/
+  quay.io: harbor.example.com/quay
+costLabels:
+  team: file
+`
+
+func TestBuildConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfigFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nullMaps := filepath.Join(t.TempDir(), "null.yaml")
+	if err := os.WriteFile(nullMaps, []byte("apiVersion: config.hcp-deployment-controller/v1alpha1\nkind: HCPDeploymentControllerConfiguration\nregistryMirrors:\n#  docker.io: harbor.example.com/dockerhub\ncostLabels:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		args  []string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg, NewDefaultConfig()) {
+					t.Errorf("BuildConfig() = %+v, want defaults", cfg)
+				}
+			},
+		},
+		{
+			name: "file overrides defaults",
+			path: path,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Workers != 4 || cfg.ProbeAddress != ":9090" {
+					t.Errorf("workers, probeAddress = %d, %q, want 4, \":9090\"", cfg.Workers, cfg.ProbeAddress)
+				}
+				if cfg.ResyncPeriod.Duration != 30*time.Second {
+					t.Errorf("resyncPeriod = %s, want default 30s", cfg.ResyncPeriod.Duration)
+				}
+				want := RegistryMirrors{"docker.io": "harbor.example.com/dockerhub", "quay.io": "harbor.example.com/quay"}
+				if !reflect.DeepEqual(cfg.RegistryMirrors, want) {
+					t.Errorf("registryMirrors = %v, want %v", cfg.RegistryMirrors, want)
+				}
+			},
+		},
+		{
+			name: "explicit flags override file",
+			path: path,
+			args: []string{"--workers=2", "--resync-period=1m", "--registry-mirror=docker.io=mirror.local/hub", "--cost-label=team=flag,env=prod"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Workers != 2 {
+					t.Errorf("workers = %d, want 2 from flag even though it is the default", cfg.Workers)
+				}
+				if cfg.ResyncPeriod.Duration != time.Minute {
+					t.Errorf("resyncPeriod = %s, want 1m", cfg.ResyncPeriod.Duration)
+				}
+				if cfg.ProbeAddress != ":9090" {
+					t.Errorf("probeAddress = %q, want \":9090\" from file", cfg.ProbeAddress)
+				}
+				mirrors := RegistryMirrors{"docker.io": "mirror.local/hub", "quay.io": "harbor.example.com/quay"}
+				if !reflect.DeepEqual(cfg.RegistryMirrors, mirrors) {
+					t.Errorf("registryMirrors = %v, want %v", cfg.RegistryMirrors, mirrors)
+				}
+				labels := CostLabels{"team": "flag", "env": "prod"}
+				if !reflect.DeepEqual(cfg.CostLabels, labels) {
+					t.Errorf("costLabels = %v, want %v", cfg.CostLabels, labels)
+				}
+			},
+		},
+		{
+			name: "flags fill maps that are null in the file",
+			path: nullMaps,
+			args: []string{"--registry-mirror=docker.io=mirror.local/hub", "--cost-label=team=flag"},
+			check: func(t *testing.T, cfg *Config) {
+				if want := (RegistryMirrors{"docker.io": "mirror.local/hub"}); !reflect.DeepEqual(cfg.RegistryMirrors, want) {
+					t.Errorf("registryMirrors = %v, want %v", cfg.RegistryMirrors, want)
+				}
+				if want := (CostLabels{"team": "flag"}); !reflect.DeepEqual(cfg.CostLabels, want) {
+					t.Errorf("costLabels = %v, want %v", cfg.CostLabels, want)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			NewDefaultConfig().AddFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := BuildConfig(tt.path, fs)
+			if err != nil {
+				t.Fatalf("BuildConfig() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestBuildConfigInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("apiVersion: v1\nkind: Config\nworkers: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildConfig(path, flag.NewFlagSet("test", flag.ContinueOnError)); err == nil {
+		t.Error("BuildConfig() error = nil, want invalid apiVersion, kind and workers")
+	}
+}
@@ -3,8 +3,11 @@ package controller
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
+	resourcev1alpha1 "hcp-pkg/apis/resource/v1alpha1"
 	resourcev1alpha1clientset "hcp-pkg/client/resource/v1alpha1/clientset/versioned"
 	resourcev1alpha1scheme "hcp-pkg/client/resource/v1alpha1/clientset/versioned/scheme"
 	Informer "hcp-pkg/client/resource/v1alpha1/informers/externalversions/resource/v1alpha1"
@@ -14,10 +17,10 @@ import (
 
 	"hcp-scheduler/src/scheduler"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -31,6 +34,12 @@ import (
 
 const controllerAgentName = "hcp-deployment-controller"
 
+// drainTimeout bounds how long Run waits for workers to finish the items they
+// are processing on shutdown. It stays below the default 30s termination
+// grace period of the controller pod so that workers finish before the pod is
+// killed.
+const drainTimeout = 20 * time.Second
+
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a Foo is synced
 	SuccessSynced = "Synced"
@@ -44,6 +53,44 @@ const (
 	// MessageResourceSynced is the message used for an Event fired when a Foo
 	// is synced successfully
 	MessageResourceSynced = "Foo synced successfully"
+
+	// ErrImageNotMirrored is used as part of the Event 'reason' when a
+	// HCPDeployment is not deployed because it references images outside the
+	// configured registry mirrors
+	ErrImageNotMirrored = "ErrImageNotMirrored"
+	// MessageImageNotMirrored is the message used for Events when a
+	// HCPDeployment references images outside the configured registry mirrors
+	MessageImageNotMirrored = "Images %v are not served by a registry mirror"
+
+	// ErrManagedLimitReached is used as part of the Event 'reason' when a
+	// HCPDeployment is not managed because the controller already manages
+	// the maximum number of HCPDeployments
+	ErrManagedLimitReached = "ErrManagedLimitReached"
+	// MessageManagedLimitReached is the message used for Events when a
+	// HCPDeployment is refused because of the managed HCPDeployment limit
+	MessageManagedLimitReached = "Controller already manages the maximum of %d HCPDeployments"
+
+	// ErrInvalidPause is used as part of the Event 'reason' when the
+	// paused-until annotation of a HCPDeployment cannot be parsed
+	ErrInvalidPause = "ErrInvalidPause"
+	// MessageInvalidPause is the message used for Events when the
+	// paused-until annotation of a HCPDeployment cannot be parsed
+	MessageInvalidPause = "Treating HCPDeployment as paused, invalid annotation %s: %v"
+
+	// ErrInvalidCostLabel is used as part of the Event 'reason' when a
+	// configured cost label cannot be added to the Deployments of a
+	// HCPDeployment
+	ErrInvalidCostLabel = "ErrInvalidCostLabel"
+	// MessageInvalidCostLabel is the message used for Events when a cost
+	// label is skipped
+	MessageInvalidCostLabel = "Skipping %s"
+
+	// ShuttingDown is used as part of the Event 'reason' when the controller
+	// stops taking new work and waits for its workers
+	ShuttingDown = "ShuttingDown"
+	// MessageShuttingDown is the message used for an Event fired on the
+	// controller pod when it starts shutting down
+	MessageShuttingDown = "Finishing HCPDeployments in progress before shutdown, %d queued HCPDeployments are left to the next controller"
 )
 
 type Controller struct {
@@ -53,13 +100,21 @@ type Controller struct {
 	hcpdeploymentSynced    cache.InformerSynced
 	workqueue              workqueue.RateLimitingInterface
 	recorder               record.EventRecorder
+	eventBroadCaster       record.EventBroadcaster
 	scheduler              *scheduler.Scheduler
+
+	configLock sync.RWMutex
+	config     *Config
+
+	managedLock sync.Mutex
+	managed     map[string]struct{}
 }
 
 func NewController(
 	kubeclientset kubernetes.Interface,
 	hcpdeploymentclientset resourcev1alpha1clientset.Interface,
-	hcpdeploymentInformer Informer.HCPDeploymentInformer) *Controller {
+	hcpdeploymentInformer Informer.HCPDeploymentInformer,
+	config *Config) *Controller {
 	utilruntime.Must(resourcev1alpha1scheme.AddToScheme(scheme.Scheme))
 	klog.V(4).Infof("Creating event broadcaster")
 	eventBroadCaster := record.NewBroadcaster()
@@ -75,7 +130,10 @@ func NewController(
 		hcpdeploymentSynced:    hcpdeploymentInformer.Informer().HasSynced,
 		workqueue:              workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "hcpdeployment"),
 		recorder:               recorder,
+		eventBroadCaster:       eventBroadCaster,
 		scheduler:              sched,
+		config:                 config,
+		managed:                map[string]struct{}{},
 	}
 
 	klog.Infof("Setting up event handlers")
@@ -85,6 +143,7 @@ func NewController(
 		UpdateFunc: func(old, new interface{}) {
 			controller.enqueneHCPdeployment(new)
 		},
+		DeleteFunc: controller.enqueneHCPdeployment,
 	})
 
 	return controller
@@ -93,19 +152,70 @@ func NewController(
 func (c *Controller) enqueneHCPdeployment(obj interface{}) {
 	var key string
 	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
 		utilruntime.HandleError(err)
 		return
 	}
 	c.workqueue.Add(key)
 }
 
+// admit reports whether the HCPDeployment with the given key may be deployed
+// without the controller managing more than maxManaged HCPDeployments, and
+// reserves a slot for it if so. Zero means unlimited. HCPDeployments that are
+// already deployed (SchedulingComplete) and those holding a slot count as
+// managed, so reserving is only needed for new deployments. A slot stays
+// reserved until the HCPDeployment is deleted, even if deploying it failed,
+// since a failed deploy may have created Deployments in some member clusters.
+func (c *Controller) admit(key string, maxManaged int) (bool, error) {
+	if maxManaged <= 0 {
+		return true, nil
+	}
+	hcpdeployments, err := c.hcpdeploymentLister.List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+
+	c.managedLock.Lock()
+	defer c.managedLock.Unlock()
+	managed := make(map[string]struct{}, len(c.managed))
+	for k := range c.managed {
+		managed[k] = struct{}{}
+	}
+	for _, hcpdeployment := range hcpdeployments {
+		if hcpdeployment.Spec.SchedulingComplete {
+			k, err := cache.MetaNamespaceKeyFunc(hcpdeployment)
+			if err != nil {
+				return false, err
+			}
+			managed[k] = struct{}{}
+		}
+	}
+	if _, ok := managed[key]; ok {
+		return true, nil
+	}
+	if len(managed) >= maxManaged {
+		return false, nil
+	}
+	c.managed[key] = struct{}{}
+	return true, nil
+}
+
+// release frees the slot held by the HCPDeployment with the given key.
+func (c *Controller) release(key string) {
+	c.managedLock.Lock()
+	defer c.managedLock.Unlock()
+	delete(c.managed, key)
+}
+
 // Run will set up the event handlers for types we are interested in, as well
 // as syncing Informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
+// is closed, at which point workers stop taking new items and Run waits, up to
+// drainTimeout, for them to finish the items they are processing. Items still
+// queued are not processed; the next controller picks them up from its
+// initial list.
 func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
+	defer c.eventBroadCaster.Shutdown()
 	defer c.workqueue.ShutDown()
 
 	// Start the Informer factories to begin populating the Informer caches
@@ -117,25 +227,85 @@ func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
 	}
 
 	klog.Infof("Starting workers")
-	// Launch two workers to process Foo resources
+	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(func() { c.runWorker(stopCh) }, time.Second, stopCh)
+		}()
 	}
 
 	klog.Infof("Started workers")
 	<-stopCh
 	klog.Infof("Shutting down workers")
+	c.shutdown(&wg)
 
 	return nil
 }
 
-//
+// shutdown records a shutdown event on the controller pod and waits for the
+// workers to finish the items they are processing, so that a controller
+// rollout does not abandon a HCPDeployment halfway through being deployed.
+func (c *Controller) shutdown(workers *sync.WaitGroup) {
+	c.recordShutdown()
+
+	// 대기 중인 워커를 깨워 종료시키고 처리 중인 항목만 완료
+	c.workqueue.ShutDown()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		klog.Infof("Workers finished")
+	case <-time.After(drainTimeout):
+		klog.Warningf("Timed out after %s waiting for workers to finish", drainTimeout)
+	}
+}
+
+// recordShutdown creates the ShuttingDown event on the controller pod
+// directly rather than through the recorder, whose broadcaster drops pending
+// events when it is shut down as the controller exits.
+func (c *Controller) recordShutdown() {
+	pod, namespace := os.Getenv("POD_NAME"), os.Getenv("WATCH_NAMESPACE")
+	if pod == "" || namespace == "" {
+		return
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", pod, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Name: pod, Namespace: namespace},
+		Reason:         ShuttingDown,
+		Message:        fmt.Sprintf(MessageShuttingDown, c.workqueue.Len()),
+		Source:         corev1.EventSource{Component: controllerAgentName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           corev1.EventTypeNormal,
+	}
+	if _, err := c.kubeclientset.CoreV1().Events(namespace).Create(context.TODO(), event, metav1.CreateOptions{}); err != nil {
+		klog.Errorf("Error recording shutdown event: %s", err.Error())
+	}
+}
 
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
-// workqueue.
-func (c *Controller) runWorker() {
-	for c.processNextWorkItem() {
+// workqueue, until stopCh is closed.
+func (c *Controller) runWorker(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		if !c.processNextWorkItem() {
+			return
+		}
 	}
 }
 
@@ -201,6 +371,7 @@ func (c *Controller) syncHandler(key string) error {
 		return nil
 	}
 
+	config := c.getConfig()
 	cm, _ := clusterManager.NewClusterManager()
 	hcpdeployment, err := c.hcpdeploymentLister.HCPDeployments(namespace).Get(name)
 	if err != nil {
@@ -208,6 +379,30 @@ func (c *Controller) syncHandler(key string) error {
 		// processing.
 		if errors.IsNotFound(err) {
 			utilruntime.HandleError(fmt.Errorf("HCPDeployment '%s' in work queue no longer exists", key))
+			c.release(key)
+			return nil
+		}
+	}
+
+	// 일시 중지된 hcpdeployment는 변경하지 않고 재개 시점에 다시 처리
+	paused, err := pausedFor(hcpdeployment, time.Now())
+	if err != nil {
+		c.recorder.Eventf(hcpdeployment, corev1.EventTypeWarning, ErrInvalidPause, MessageInvalidPause, PausedUntilAnnotation, err)
+	}
+	if paused < 0 {
+		klog.Infof("HCPDeployment '%s' is paused", key)
+		return nil
+	} else if paused > 0 {
+		klog.Infof("HCPDeployment '%s' is paused for %s", key, paused)
+		c.workqueue.AddAfter(key, paused)
+		return nil
+	}
+
+	// 폐쇄망 모드에서는 미러되지 않은 이미지를 사용하는 hcpdeployment 배포 거부
+	if config.RequireRegistryMirror {
+		if images := config.RegistryMirrors.Unmirrored(&hcpdeployment.Spec.RealDeploymentSpec.Template.Spec); len(images) > 0 {
+			c.recorder.Eventf(hcpdeployment, corev1.EventTypeWarning, ErrImageNotMirrored, MessageImageNotMirrored, images)
+			klog.Errorf("HCPDeployment '%s' references unmirrored images %v", key, images)
 			return nil
 		}
 	}
@@ -217,9 +412,27 @@ func (c *Controller) syncHandler(key string) error {
 
 	// 스케줄링되지 않은 hcpdeployment 감지
 	if !hcpdeployment.Spec.SchedulingNeed && !hcpdeployment.Spec.SchedulingComplete {
-		uid, ok := deployment.DeployDeploymentFromHCPDeployment(hcpdeployment)
+		// 관리 가능한 최대 hcpdeployment 수를 초과한 경우 신규 배포 거부
+		admitted, err := c.admit(key, config.MaxHCPDeployments)
+		if err != nil {
+			return err
+		}
+		if !admitted {
+			c.recorder.Eventf(hcpdeployment, corev1.EventTypeWarning, ErrManagedLimitReached, MessageManagedLimitReached, config.MaxHCPDeployments)
+			klog.Errorf("HCPDeployment '%s' refused: controller already manages %d HCPDeployments", key, config.MaxHCPDeployments)
+			return nil
+		}
+
+		// 레지스트리 미러, 비용 레이블 등 컨트롤러 설정을 적용한 사본으로 배포
+		deploy, skipped := customize(hcpdeployment, config)
+		c.recordSkippedCostLabels(hcpdeployment, skipped)
+		ensureLabels(deploy)
+		uid, ok := deployment.DeployDeploymentFromHCPDeployment(deploy)
 		if ok {
 			klog.Infof("Succeed to deploy deployment %s\n", hcpdeployment.ObjectMeta.Name)
+			// 배포된 사본과 같은 uuid 레이블을 저장하여 재배포 시에도 동일하게 유지
+			hcpdeployment = hcpdeployment.DeepCopy()
+			setUUIDLabels(hcpdeployment, uid)
 			hcpdeployment.Spec.SchedulingComplete = true
 			hcpdeployment.Spec.UUID = uid
 			klog.Infof(">>>", uid)
@@ -230,6 +443,7 @@ func (c *Controller) syncHandler(key string) error {
 				klog.Infof("Update HCPDeployment %s SchedulingComplete: %t\n", r.ObjectMeta.Name, r.Spec.SchedulingComplete)
 			}
 		}
+		// 일부 클러스터에만 배포된 경우에도 슬롯은 hcpdeployment 삭제 시까지 유지
 	} else if !hcpdeployment.Spec.SchedulingNeed && hcpdeployment.Spec.SchedulingComplete {
 		targets := hcpdeployment.Spec.SchedulingResult.Targets
 		redeployneed := false
@@ -249,15 +463,11 @@ func (c *Controller) syncHandler(key string) error {
 		}
 
 		if redeployneed {
+			deploy, skipped := customize(hcpdeployment, config)
+			c.recordSkippedCostLabels(hcpdeployment, skipped)
 			for key, value := range redeploytarget {
 				clientset := cm.Cluster_kubeClients[key]
-				redeploydeployment := &appsv1.Deployment{}
-				redeploydeployment.ObjectMeta = hcpdeployment.Spec.RealDeploymentMetadata
-				if redeploydeployment.Namespace == "" {
-					redeploydeployment.Namespace = "default"
-				}
-				redeploydeployment.Spec = hcpdeployment.Spec.RealDeploymentSpec
-				redeploydeployment.Spec.Replicas = &value
+				redeploydeployment := newDeployment(deploy, value)
 				err := deployment.CreateDeployment(clientset, "", redeploydeployment)
 				if err != nil {
 					klog.Error(err)
@@ -273,3 +483,11 @@ func (c *Controller) syncHandler(key string) error {
 
 	return nil
 }
+
+// recordSkippedCostLabels records a warning event on hcpdeployment for every
+// cost label that could not be added to its Deployments.
+func (c *Controller) recordSkippedCostLabels(hcpdeployment *resourcev1alpha1.HCPDeployment, skipped []string) {
+	for _, msg := range skipped {
+		c.recorder.Eventf(hcpdeployment, corev1.EventTypeWarning, ErrInvalidCostLabel, MessageInvalidCostLabel, msg)
+	}
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"testing"
+
+	resourcev1alpha1 "hcp-pkg/apis/resource/v1alpha1"
+	lister "hcp-pkg/client/resource/v1alpha1/listers/resource/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestHCPDeployment(name string, complete bool) *resourcev1alpha1.HCPDeployment {
+	return &resourcev1alpha1.HCPDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "hcp"},
+		Spec:       resourcev1alpha1.HCPDeploymentSpec{SchedulingComplete: complete},
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name         string
+		objects      []*resourcev1alpha1.HCPDeployment
+		reserved     []string
+		released     []string
+		key          string
+		maxManaged   int
+		want         bool
+		wantReserved bool
+	}{
+		{
+			name:       "unlimited",
+			objects:    []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true), newTestHCPDeployment("b", true)},
+			key:        "hcp/c",
+			maxManaged: 0,
+			want:       true,
+		},
+		{
+			name:         "below limit",
+			objects:      []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true)},
+			key:          "hcp/c",
+			maxManaged:   2,
+			want:         true,
+			wantReserved: true,
+		},
+		{
+			name:       "limit reached by deployed HCPDeployments",
+			objects:    []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true), newTestHCPDeployment("b", true)},
+			key:        "hcp/c",
+			maxManaged: 2,
+			want:       false,
+		},
+		{
+			name:         "HCPDeployments that are not deployed are not counted",
+			objects:      []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true), newTestHCPDeployment("b", false)},
+			key:          "hcp/c",
+			maxManaged:   2,
+			want:         true,
+			wantReserved: true,
+		},
+		{
+			name:       "limit reached by reservations",
+			objects:    []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true)},
+			reserved:   []string{"hcp/b"},
+			key:        "hcp/c",
+			maxManaged: 2,
+			want:       false,
+		},
+		{
+			name:         "deployed and reserved HCPDeployment counted once",
+			objects:      []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true)},
+			reserved:     []string{"hcp/a"},
+			key:          "hcp/c",
+			maxManaged:   2,
+			want:         true,
+			wantReserved: true,
+		},
+		{
+			name:         "key already reserved",
+			objects:      []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true)},
+			reserved:     []string{"hcp/c"},
+			key:          "hcp/c",
+			maxManaged:   2,
+			want:         true,
+			wantReserved: true,
+		},
+		{
+			name:       "key already deployed",
+			objects:    []*resourcev1alpha1.HCPDeployment{newTestHCPDeployment("a", true), newTestHCPDeployment("c", true)},
+			key:        "hcp/c",
+			maxManaged: 1,
+			want:       true,
+		},
+		{
+			name:         "released on delete",
+			reserved:     []string{"hcp/a", "hcp/b"},
+			released:     []string{"hcp/b"},
+			key:          "hcp/c",
+			maxManaged:   2,
+			want:         true,
+			wantReserved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, obj := range tt.objects {
+				if err := indexer.Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c := &Controller{
+				hcpdeploymentLister: lister.NewHCPDeploymentLister(indexer),
+				managed:             map[string]struct{}{},
+			}
+			for _, key := range tt.reserved {
+				c.managed[key] = struct{}{}
+			}
+			for _, key := range tt.released {
+				c.release(key)
+			}
+
+			got, err := c.admit(tt.key, tt.maxManaged)
+			if err != nil {
+				t.Fatalf("admit() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("admit() = %t, want %t", got, tt.want)
+			}
+			if _, reserved := c.managed[tt.key]; reserved != tt.wantReserved {
+				t.Errorf("%s reserved = %t, want %t", tt.key, reserved, tt.wantReserved)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	resourcev1alpha1 "hcp-pkg/apis/resource/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// CostLabels are stamped on every Deployment and pod template the controller
+// creates so that cost tools such as OpenCost can attribute member cluster
+// spend back to the originating HCPDeployment. Values may reference the
+// HCPDeployment with the {name} and {namespace} placeholders. It implements
+// flag.Value so it can be filled from repeated "key=value" flags, or comma
+// separated lists of them.
+type CostLabels map[string]string
+
+func (l CostLabels) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l CostLabels) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid cost label %q, expected key=value", pair)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid cost label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		l[key] = val
+	}
+	return nil
+}
+
+// Apply adds the labels, with placeholders resolved against hcpdeployment, to
+// the deployment metadata and pod template of hcpdeployment in place. Labels
+// whose key is part of the Deployment selector, including the uuid label, are
+// skipped so that they cannot change which pods the Deployment selects, as are
+// labels whose resolved value is not a valid label value. A message is returned
+// for every skipped label.
+func (l CostLabels) Apply(hcpdeployment *resourcev1alpha1.HCPDeployment) []string {
+	if len(l) == 0 {
+		return nil
+	}
+	r := strings.NewReplacer("{name}", hcpdeployment.Name, "{namespace}", hcpdeployment.Namespace)
+	meta := &hcpdeployment.Spec.RealDeploymentMetadata
+	template := &hcpdeployment.Spec.RealDeploymentSpec.Template
+	var selector map[string]string
+	if s := hcpdeployment.Spec.RealDeploymentSpec.Selector; s != nil {
+		selector = s.MatchLabels
+	}
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	if template.Labels == nil {
+		template.Labels = map[string]string{}
+	}
+
+	var skipped []string
+	for key, value := range l {
+		if _, ok := selector[key]; ok || key == uuidLabel {
+			skipped = append(skipped, fmt.Sprintf("cost label %s is part of the Deployment selector", key))
+			continue
+		}
+		value = r.Replace(value)
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			skipped = append(skipped, fmt.Sprintf("cost label %s=%q: %s", key, value, strings.Join(errs, "; ")))
+			continue
+		}
+		meta.Labels[key] = value
+		template.Labels[key] = value
+	}
+	sort.Strings(skipped)
+	return skipped
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func FuzzCostLabelsSet(f *testing.F) {
+	for _, value := range []string{"team=platform", "opencost.io/hcpdeployment={namespace}.{name},env=prod", "a=b=c", "=", ","} {
+		f.Add(value)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		l := CostLabels{}
+		if err := l.Set(value); err != nil {
+			return
+		}
+		for key := range l {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				t.Errorf("Set(%q) stored invalid key %q: %v", value, key, errs)
+			}
+		}
+		roundTrip := CostLabels{}
+		if err := roundTrip.Set(l.String()); err != nil || !reflect.DeepEqual(roundTrip, l) {
+			t.Errorf("Set(%q) = %v, which does not round trip through String: %v, %v", value, l, roundTrip, err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"time"
+
+	resourcev1alpha1 "hcp-pkg/apis/resource/v1alpha1"
+)
+
+// PausedUntilAnnotation stops the controller from deploying, redeploying or
+// updating a HCPDeployment. Its value is either "true", pausing until the
+// annotation is removed, or an RFC3339 timestamp after which reconciliation
+// resumes.
+const PausedUntilAnnotation = "hcp-deployment-controller/paused-until"
+
+// pausedFor returns how long reconciliation of hcpdeployment stays paused.
+// A negative duration means paused until the annotation is removed and zero
+// means not paused. An unparsable value is returned as an error together with
+// a negative duration, so that a mistyped timestamp keeps the HCPDeployment
+// paused rather than resuming reconciliation.
+func pausedFor(hcpdeployment *resourcev1alpha1.HCPDeployment, now time.Time) (time.Duration, error) {
+	value, ok := hcpdeployment.Annotations[PausedUntilAnnotation]
+	if !ok || value == "" || value == "false" {
+		return 0, nil
+	}
+	if value == "true" {
+		return -1, nil
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return -1, err
+	}
+	if !until.After(now) {
+		return 0, nil
+	}
+	return until.Sub(now), nil
+}
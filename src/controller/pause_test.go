@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	resourcev1alpha1 "hcp-pkg/apis/resource/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPausedFor(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   *string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "no annotation", value: nil, want: 0},
+		{name: "empty", value: strPtr(""), want: 0},
+		{name: "false", value: strPtr("false"), want: 0},
+		{name: "true", value: strPtr("true"), want: -1},
+		{name: "past", value: strPtr("2024-01-01T11:00:00Z"), want: 0},
+		{name: "now", value: strPtr("2024-01-01T12:00:00Z"), want: 0},
+		{name: "future", value: strPtr("2024-01-01T13:30:00Z"), want: 90 * time.Minute},
+		{name: "invalid", value: strPtr("tomorrow"), want: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcpdeployment := &resourcev1alpha1.HCPDeployment{}
+			if tt.value != nil {
+				hcpdeployment.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{PausedUntilAnnotation: *tt.value}}
+			}
+			got, err := pausedFor(hcpdeployment, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pausedFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("pausedFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func FuzzPausedFor(f *testing.F) {
+	for _, value := range []string{"", "true", "false", "2024-01-01T13:30:00Z", "2024-01-01T13:30:00+09:00", "tomorrow"} {
+		f.Add(value)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, value string) {
+		hcpdeployment := &resourcev1alpha1.HCPDeployment{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{PausedUntilAnnotation: value}},
+		}
+		got, err := pausedFor(hcpdeployment, now)
+		if err != nil && got >= 0 {
+			t.Errorf("pausedFor(%q) = %s, %v, want an invalid value to stay paused", value, got, err)
+		}
+		if got < 0 && got != -1 {
+			t.Errorf("pausedFor(%q) = %s, want -1 for paused until the annotation is removed", value, got)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	resourcev1alpha1clientset "hcp-pkg/client/resource/v1alpha1/clientset/versioned"
+	"hcp-pkg/util/clusterManager"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Preflight verifies the capabilities the controller relies on: the
+// HCPDeployment API on the host cluster, permission to record events there,
+// and permission to manage Deployments in every member cluster. The result of
+// the last run is served as a readiness endpoint.
+type Preflight struct {
+	cm *clusterManager.ClusterManager
+
+	lock     sync.RWMutex
+	ran      bool
+	failures []string
+}
+
+func NewPreflight(cm *clusterManager.ClusterManager) *Preflight {
+	return &Preflight{cm: cm}
+}
+
+// Run performs all checks, logs any failures and records them for the
+// readiness endpoint. It returns the failures found.
+func (p *Preflight) Run() []string {
+	var failures []string
+	failures = append(failures, checkHCPDeploymentAPI(p.cm.HCPResource_Client)...)
+	failures = append(failures, checkAccess(p.cm.Host_kubeClient, "host", authorizationv1.ResourceAttributes{
+		Namespace: "hcp",
+		Verb:      "create",
+		Resource:  "events",
+	})...)
+	for name, clientset := range p.cm.Cluster_kubeClients {
+		for _, verb := range []string{"get", "create"} {
+			failures = append(failures, checkAccess(clientset, name, authorizationv1.ResourceAttributes{
+				Verb:     verb,
+				Group:    "apps",
+				Resource: "deployments",
+			})...)
+		}
+	}
+
+	for _, failure := range failures {
+		klog.Errorf("Preflight check failed: %s", failure)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ran = true
+	p.failures = failures
+	return failures
+}
+
+// ServeHTTP reports ready only once a run has completed and the last run
+// found no failures.
+func (p *Preflight) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if !p.ran {
+		http.Error(w, "preflight checks have not completed yet", http.StatusServiceUnavailable)
+		return
+	}
+	if len(p.failures) > 0 {
+		http.Error(w, strings.Join(p.failures, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func checkHCPDeploymentAPI(clientset resourcev1alpha1clientset.Interface) []string {
+	_, err := clientset.HcpV1alpha1().HCPDeployments("hcp").List(context.TODO(), metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return []string{fmt.Sprintf("cannot list HCPDeployments in the host cluster: %v", err)}
+	}
+	return nil
+}
+
+func checkAccess(clientset kubernetes.Interface, cluster string, attributes authorizationv1.ResourceAttributes) []string {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+	}
+	r, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+	if err != nil {
+		return []string{fmt.Sprintf("cannot review access in cluster %s: %v", cluster, err)}
+	}
+	if !r.Status.Allowed {
+		return []string{fmt.Sprintf("not allowed to %s %s in cluster %s", attributes.Verb, attributes.Resource, cluster)}
+	}
+	return nil
+}
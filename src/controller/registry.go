@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const defaultRegistry = "docker.io"
+
+// RegistryMirrors maps a source registry (e.g. registry.k8s.io) to the mirror
+// that should be used in its place (e.g. harbor.example.com/k8s). It
+// implements flag.Value so it can be filled from repeated command line flags
+// of the form "source=mirror", or comma separated lists of them.
+type RegistryMirrors map[string]string
+
+func (m RegistryMirrors) String() string {
+	pairs := make([]string, 0, len(m))
+	for source, mirror := range m {
+		pairs = append(pairs, source+"="+mirror)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m RegistryMirrors) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		source, mirror, ok := strings.Cut(pair, "=")
+		mirror = strings.TrimRight(mirror, "/")
+		if !ok || source == "" || mirror == "" {
+			return fmt.Errorf("invalid registry mirror %q, expected source=mirror", pair)
+		}
+		m[source] = mirror
+	}
+	return nil
+}
+
+// Rewrite returns image with its registry replaced by the configured mirror.
+// Images whose registry has no mirror are returned unchanged.
+func (m RegistryMirrors) Rewrite(image string) string {
+	registry, repository := splitImage(image)
+	if mirror, ok := m[registry]; ok {
+		return mirror + "/" + repository
+	}
+	return image
+}
+
+// Mirrored reports whether image is served by a mirror, either because its
+// registry has a mirror configured or because it already points at one.
+func (m RegistryMirrors) Mirrored(image string) bool {
+	for _, mirror := range m {
+		if strings.HasPrefix(image, mirror+"/") {
+			return true
+		}
+	}
+	registry, _ := splitImage(image)
+	_, ok := m[registry]
+	return ok
+}
+
+// Unmirrored returns the images in spec that are not served by a mirror.
+func (m RegistryMirrors) Unmirrored(spec *corev1.PodSpec) []string {
+	var images []string
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			if !m.Mirrored(c.Image) {
+				images = append(images, c.Image)
+			}
+		}
+	}
+	return images
+}
+
+// Apply rewrites the images of every container in spec in place.
+func (m RegistryMirrors) Apply(spec *corev1.PodSpec) {
+	if len(m) == 0 {
+		return
+	}
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Image = m.Rewrite(spec.InitContainers[i].Image)
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Image = m.Rewrite(spec.Containers[i].Image)
+	}
+}
+
+// splitImage splits an image reference into its registry host and the
+// remaining repository path, following the docker reference rules: the first
+// component is only a registry if it looks like a host name.
+func splitImage(image string) (string, string) {
+	first, rest, ok := strings.Cut(image, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest
+	}
+	if !ok {
+		return defaultRegistry, "library/" + image
+	}
+	return defaultRegistry, image
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		registry   string
+		repository string
+	}{
+		{"nginx", "docker.io", "library/nginx"},
+		{"nginx:1.25", "docker.io", "library/nginx:1.25"},
+		{"nginx@sha256:0123456789abcdef", "docker.io", "library/nginx@sha256:0123456789abcdef"},
+		{"bitnami/redis:7.2", "docker.io", "bitnami/redis:7.2"},
+		{"localhost/x", "localhost", "x"},
+		{"localhost:5000/x", "localhost:5000", "x"},
+		{"registry.k8s.io/pause:3.9", "registry.k8s.io", "pause:3.9"},
+		{"registry.k8s.io/pause@sha256:0123456789abcdef", "registry.k8s.io", "pause@sha256:0123456789abcdef"},
+		{"harbor.example.com:8443/k8s/pause:3.9", "harbor.example.com:8443", "k8s/pause:3.9"},
+	}
+	for _, tt := range tests {
+		registry, repository := splitImage(tt.image)
+		if registry != tt.registry || repository != tt.repository {
+			t.Errorf("splitImage(%q) = %q, %q, want %q, %q", tt.image, registry, repository, tt.registry, tt.repository)
+		}
+	}
+}
+
+func TestRegistryMirrorsSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RegistryMirrors
+		wantErr bool
+	}{
+		{value: "registry.k8s.io=harbor.example.com/k8s", want: RegistryMirrors{"registry.k8s.io": "harbor.example.com/k8s"}},
+		{value: "docker.io=mirror.local/hub//,quay.io=mirror.local/quay", want: RegistryMirrors{"docker.io": "mirror.local/hub", "quay.io": "mirror.local/quay"}},
+		{value: "docker.io", wantErr: true},
+		{value: "=mirror.local", wantErr: true},
+		{value: "docker.io=", wantErr: true},
+		{value: "docker.io=/", wantErr: true},
+	}
+	for _, tt := range tests {
+		m := RegistryMirrors{}
+		err := m.Set(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(m, tt.want) {
+			t.Errorf("Set(%q) = %v, want %v", tt.value, m, tt.want)
+		}
+	}
+}
+
+func FuzzSplitImage(f *testing.F) {
+	for _, image := range []string{"nginx", "bitnami/redis:7.2", "localhost:5000/x", "registry.k8s.io/pause@sha256:0123456789abcdef", ""} {
+		f.Add(image)
+	}
+	f.Fuzz(func(t *testing.T, image string) {
+		registry, repository := splitImage(image)
+		if registry+"/"+repository != image && repository != image && repository != "library/"+image {
+			t.Errorf("splitImage(%q) = %q, %q, which does not reassemble to the image", image, registry, repository)
+		}
+	})
+}
+
+func FuzzRegistryMirrorsSet(f *testing.F) {
+	for _, value := range []string{"registry.k8s.io=harbor.example.com/k8s", "docker.io=mirror/,quay.io=mirror2", "a=b=c", "=", ","} {
+		f.Add(value)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		m := RegistryMirrors{}
+		if err := m.Set(value); err != nil {
+			return
+		}
+		for source, mirror := range m {
+			if source == "" || mirror == "" || strings.HasSuffix(mirror, "/") {
+				t.Errorf("Set(%q) stored invalid mirror %q=%q", value, source, mirror)
+			}
+		}
+		roundTrip := RegistryMirrors{}
+		if err := roundTrip.Set(m.String()); err != nil || !reflect.DeepEqual(roundTrip, m) {
+			t.Errorf("Set(%q) = %v, which does not round trip through String: %v, %v", value, m, roundTrip, err)
+		}
+	})
+}
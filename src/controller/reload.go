@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// getConfig returns the configuration currently in effect.
+func (c *Controller) getConfig() *Config {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+	return c.config
+}
+
+// UpdateConfig applies the settings of cfg that are safe to change at
+// runtime: log level, registry mirrors, cost labels and the managed
+// HCPDeployment limit. Workers, resync period and probe address only take
+// effect at startup, so their current values are kept.
+func (c *Controller) UpdateConfig(cfg *Config) {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+
+	updated := *cfg
+	if cfg.Workers != c.config.Workers || cfg.ResyncPeriod != c.config.ResyncPeriod || cfg.ProbeAddress != c.config.ProbeAddress {
+		klog.Warningf("Changes to workers, resyncPeriod and probeAddress take effect after a restart")
+		updated.Workers = c.config.Workers
+		updated.ResyncPeriod = c.config.ResyncPeriod
+		updated.ProbeAddress = c.config.ProbeAddress
+	}
+	ApplyLogLevel(&updated)
+	c.config = &updated
+}
+
+// WatchConfig checks the configuration file at path for changes every period
+// until stopCh is closed, rebuilding the configuration together with the flags
+// set in fs and applying it with UpdateConfig. Invalid configurations are
+// logged and ignored so that the controller keeps running with the last good
+// one.
+func (c *Controller) WatchConfig(path string, fs *flag.FlagSet, period time.Duration, stopCh <-chan struct{}) {
+	last, _ := os.ReadFile(path)
+	wait.Until(func() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			klog.Errorf("Error reading configuration file %s: %s", path, err.Error())
+			return
+		}
+		if bytes.Equal(data, last) {
+			return
+		}
+		last = data
+
+		cfg, err := BuildConfig(path, fs)
+		if err != nil {
+			klog.Errorf("Ignoring invalid configuration: %s", err.Error())
+			return
+		}
+		c.UpdateConfig(cfg)
+		klog.Infof("Reloaded configuration from %s", path)
+	}, period, stopCh)
+}
+
+// flagLogLevel is the klog verbosity given with -v, recorded by the first
+// ApplyLogLevel call so that it can be restored when logLevel is removed from
+// the configuration file.
+var flagLogLevel struct {
+	once  sync.Once
+	value string
+}
+
+// ApplyLogLevel sets the klog verbosity to cfg.LogLevel if it is set, and back
+// to the value given with -v otherwise. It must first be called at startup,
+// before the verbosity is changed by anything else.
+func ApplyLogLevel(cfg *Config) {
+	v := flag.CommandLine.Lookup("v")
+	if v == nil {
+		return
+	}
+	flagLogLevel.once.Do(func() { flagLogLevel.value = v.Value.String() })
+
+	level := flagLogLevel.value
+	if cfg.LogLevel != nil {
+		level = strconv.Itoa(*cfg.LogLevel)
+	}
+	if err := v.Value.Set(level); err != nil {
+		klog.Errorf("Error setting log level: %s", err.Error())
+	}
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	c := &Controller{config: NewDefaultConfig()}
+
+	level := 4
+	updated := NewDefaultConfig()
+	updated.Workers = 8
+	updated.ResyncPeriod = metav1.Duration{Duration: time.Minute}
+	updated.ProbeAddress = ":9090"
+	updated.MaxHCPDeployments = 10
+	updated.RegistryMirrors = RegistryMirrors{"docker.io": "harbor.example.com/dockerhub"}
+	updated.RequireRegistryMirror = true
+	updated.CostLabels = CostLabels{"team": "platform"}
+	updated.LogLevel = &level
+	c.UpdateConfig(updated)
+
+	got := c.getConfig()
+	defaults := NewDefaultConfig()
+	if got.Workers != defaults.Workers || got.ResyncPeriod != defaults.ResyncPeriod || got.ProbeAddress != defaults.ProbeAddress {
+		t.Errorf("workers, resyncPeriod, probeAddress = %d, %s, %q, want the startup values %d, %s, %q",
+			got.Workers, got.ResyncPeriod.Duration, got.ProbeAddress, defaults.Workers, defaults.ResyncPeriod.Duration, defaults.ProbeAddress)
+	}
+	if got.MaxHCPDeployments != 10 || !got.RequireRegistryMirror {
+		t.Errorf("maxHCPDeployments, requireRegistryMirror = %d, %t, want 10, true", got.MaxHCPDeployments, got.RequireRegistryMirror)
+	}
+	if !reflect.DeepEqual(got.RegistryMirrors, updated.RegistryMirrors) {
+		t.Errorf("registryMirrors = %v, want %v", got.RegistryMirrors, updated.RegistryMirrors)
+	}
+	if !reflect.DeepEqual(got.CostLabels, updated.CostLabels) {
+		t.Errorf("costLabels = %v, want %v", got.CostLabels, updated.CostLabels)
+	}
+	if got.LogLevel == nil || *got.LogLevel != level {
+		t.Errorf("logLevel = %v, want %d", got.LogLevel, level)
+	}
+
+	// Removing settings from the file replaces them as well.
+	c.UpdateConfig(NewDefaultConfig())
+	if got := c.getConfig(); !reflect.DeepEqual(got, NewDefaultConfig()) {
+		t.Errorf("config after reverting to defaults = %+v, want %+v", got, NewDefaultConfig())
+	}
+}
+
+func TestApplyLogLevel(t *testing.T) {
+	// ApplyLogLevel records -v on its first call with the flag registered,
+	// which is this one: the other tests run without klog flags.
+	if flag.Lookup("v") == nil {
+		klog.InitFlags(nil)
+	}
+	if err := flag.Set("v", "3"); err != nil {
+		t.Fatal(err)
+	}
+	v := flag.Lookup("v").Value
+
+	level := 5
+	ApplyLogLevel(&Config{LogLevel: &level})
+	if v.String() != "5" {
+		t.Errorf("verbosity with logLevel 5 = %s, want 5", v)
+	}
+	ApplyLogLevel(&Config{})
+	if v.String() != "3" {
+		t.Errorf("verbosity after removing logLevel = %s, want the -v value 3", v)
+	}
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	resourcev1alpha1 "hcp-pkg/apis/resource/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// uuidLabel is the label hcp-pkg sets to the UUID of a HCPDeployment on the
+// deployment metadata, selector and pod template when first deploying it.
+const uuidLabel = "uuid"
+
+// customize returns a copy of hcpdeployment with the controller-level
+// settings applied: images are rewritten to their registry mirrors and cost
+// labels are added. Callers deploy the returned copy so that these settings
+// are never written back to the stored HCPDeployment. The cost labels that
+// could not be applied are returned as messages.
+func customize(hcpdeployment *resourcev1alpha1.HCPDeployment, config *Config) (*resourcev1alpha1.HCPDeployment, []string) {
+	deploy := hcpdeployment.DeepCopy()
+	config.RegistryMirrors.Apply(&deploy.Spec.RealDeploymentSpec.Template.Spec)
+	skipped := config.CostLabels.Apply(deploy)
+	return deploy, skipped
+}
+
+// ensureLabels allocates the label maps of the deployment metadata, selector
+// and pod template of hcpdeployment that hcp-pkg writes the uuid label to.
+func ensureLabels(hcpdeployment *resourcev1alpha1.HCPDeployment) {
+	spec := &hcpdeployment.Spec.RealDeploymentSpec
+	if hcpdeployment.Spec.RealDeploymentMetadata.Labels == nil {
+		hcpdeployment.Spec.RealDeploymentMetadata.Labels = map[string]string{}
+	}
+	if spec.Selector == nil {
+		spec.Selector = &metav1.LabelSelector{}
+	}
+	if spec.Selector.MatchLabels == nil {
+		spec.Selector.MatchLabels = map[string]string{}
+	}
+	if spec.Template.Labels == nil {
+		spec.Template.Labels = map[string]string{}
+	}
+}
+
+// setUUIDLabels sets the uuid label of hcpdeployment to uid, as hcp-pkg does
+// on the copy it deploys, so that later redeploys select the same pods.
+func setUUIDLabels(hcpdeployment *resourcev1alpha1.HCPDeployment, uid int) {
+	ensureLabels(hcpdeployment)
+	value := strconv.Itoa(uid)
+	hcpdeployment.Spec.RealDeploymentMetadata.Labels[uuidLabel] = value
+	hcpdeployment.Spec.RealDeploymentSpec.Selector.MatchLabels[uuidLabel] = value
+	hcpdeployment.Spec.RealDeploymentSpec.Template.Labels[uuidLabel] = value
+}
+
+// newDeployment builds the Deployment that is created in a member cluster for
+// hcpdeployment with the given number of replicas.
+func newDeployment(hcpdeployment *resourcev1alpha1.HCPDeployment, replicas int32) *appsv1.Deployment {
+	d := &appsv1.Deployment{}
+	d.APIVersion = appsv1.SchemeGroupVersion.String()
+	d.Kind = "Deployment"
+	d.ObjectMeta = *hcpdeployment.Spec.RealDeploymentMetadata.DeepCopy()
+	if d.Namespace == "" {
+		d.Namespace = "default"
+	}
+	d.Spec = *hcpdeployment.Spec.RealDeploymentSpec.DeepCopy()
+	d.Spec.Replicas = &replicas
+	return d
+}
+
+// Render reads a HCPDeployment manifest from path and writes the Deployments
+// the controller would create for it to w as a multi-document YAML stream,
+// one document per target cluster. Nothing is sent to any cluster.
+//
+// The output matches what the controller creates on redeploy. The first
+// deploy goes through hcp-pkg instead, which additionally sets a freshly
+// generated uuid label on the Deployment, its selector and pod template;
+// that label only appears here if the manifest already carries it. Like the
+// controller, Render refuses HCPDeployments with images outside the registry
+// mirrors when RequireRegistryMirror is set.
+func Render(path string, config *Config, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hcpdeployment := &resourcev1alpha1.HCPDeployment{}
+	if err := utilyaml.NewYAMLOrJSONDecoder(f, 4096).Decode(hcpdeployment); err != nil {
+		return fmt.Errorf("failed to decode HCPDeployment from %s: %v", path, err)
+	}
+
+	if config.RequireRegistryMirror {
+		if images := config.RegistryMirrors.Unmirrored(&hcpdeployment.Spec.RealDeploymentSpec.Template.Spec); len(images) > 0 {
+			return fmt.Errorf("HCPDeployment %q references images not served by a registry mirror: %v", hcpdeployment.Name, images)
+		}
+	}
+
+	hcpdeployment, skipped := customize(hcpdeployment, config)
+	for _, msg := range skipped {
+		klog.Warningf("Skipping %s", msg)
+	}
+	targets := hcpdeployment.Spec.SchedulingResult.Targets
+	if len(targets) == 0 {
+		return fmt.Errorf("HCPDeployment %q has no scheduling result to render", hcpdeployment.Name)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Cluster < targets[j].Cluster })
+
+	for _, target := range targets {
+		if target.Replicas == nil {
+			return fmt.Errorf("HCPDeployment %q has no replicas for cluster %s", hcpdeployment.Name, target.Cluster)
+		}
+		out, err := yaml.Marshal(newDeployment(hcpdeployment, *target.Replicas))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n# cluster: %s\n%s", target.Cluster, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
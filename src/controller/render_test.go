@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata.")
+
+// TestRenderGolden renders representative HCPDeployments and compares the
+// output with the golden files in testdata. Run with -update after an
+// intended change to the rendered Deployments.
+func TestRenderGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		config func(*Config)
+	}{
+		{
+			name:   "default",
+			input:  "hcpdeployment.yaml",
+			config: func(*Config) {},
+		},
+		{
+			name:  "mirrors-and-cost-labels",
+			input: "hcpdeployment.yaml",
+			config: func(cfg *Config) {
+				cfg.RegistryMirrors = RegistryMirrors{
+					"docker.io":       "harbor.example.com/dockerhub",
+					"registry.k8s.io": "harbor.example.com/k8s",
+				}
+				cfg.CostLabels = CostLabels{
+					"opencost.io/hcpdeployment": "{namespace}.{name}",
+					"team":                      "platform",
+					"app":                       "ignored-selector-key",
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewDefaultConfig()
+			tt.config(cfg)
+
+			var out bytes.Buffer
+			if err := Render(filepath.Join("testdata", tt.input), cfg, &out); err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden.yaml")
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("Render() output differs from %s, run with -update if the change is intended:\n%s", golden, out.String())
+			}
+		})
+	}
+}
+
+func TestRenderRequireRegistryMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirrors RegistryMirrors
+		wantErr bool
+	}{
+		{
+			name:    "unmirrored images",
+			mirrors: RegistryMirrors{"registry.k8s.io": "harbor.example.com/k8s"},
+			wantErr: true,
+		},
+		{
+			name: "all images mirrored",
+			mirrors: RegistryMirrors{
+				"docker.io":       "harbor.example.com/dockerhub",
+				"registry.k8s.io": "harbor.example.com/k8s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewDefaultConfig()
+			cfg.RequireRegistryMirror = true
+			cfg.RegistryMirrors = tt.mirrors
+
+			var out bytes.Buffer
+			err := Render(filepath.Join("testdata", "hcpdeployment.yaml"), cfg, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && out.Len() > 0 {
+				t.Errorf("Render() wrote output for a refused HCPDeployment:\n%s", out.String())
+			}
+		})
+	}
+}
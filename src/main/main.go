@@ -2,12 +2,15 @@ package main
 
 import (
 	"flag"
+	"net/http"
+	"os"
 	"time"
 
 	"hcp-pkg/util/clusterManager"
 
 	controller "hcp-deployment-controller/src/controller"
 
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/klog/v2"
@@ -20,22 +23,52 @@ import (
 )
 
 func main() {
+	configFile := flag.String("config", "", "Path to the controller configuration file. Command line flags override values set in it.")
+	controller.NewDefaultConfig().AddFlags(flag.CommandLine)
+	render := flag.String("render", "", "Render the Deployments that would be created for the HCPDeployment manifest in this file to stdout and exit.")
 	klog.InitFlags(nil)
 	flag.Parse()
 
+	cfg, err := controller.BuildConfig(*configFile, flag.CommandLine)
+	if err != nil {
+		klog.Fatalf("Invalid configuration: %s", err.Error())
+	}
+	controller.ApplyLogLevel(cfg)
+
+	if *render != "" {
+		if err := controller.Render(*render, cfg, os.Stdout); err != nil {
+			klog.Fatalf("Error rendering %s: %s", *render, err.Error())
+		}
+		return
+	}
+
 	cm, err := clusterManager.NewClusterManager()
 	if err != nil {
 		klog.Errorln(err)
 	}
 
 	stopCh := signals.SetupSignalHandler()
-	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(cm.Host_kubeClient, time.Second*30)
-	resourcev1alpha1InformerFactory := informers.NewSharedInformerFactory(cm.HCPResource_Client, time.Second*30)
 
-	controller := controller.NewController(cm.Host_kubeClient, cm.HCPResource_Client, resourcev1alpha1InformerFactory.Hcp().V1alpha1().HCPDeployments())
+	// 관리 클러스터 및 멤버 클러스터 권한을 시작 시와 주기적으로 점검
+	preflight := controller.NewPreflight(cm)
+	go wait.Until(func() { preflight.Run() }, 5*time.Minute, stopCh)
+	http.Handle("/readyz", preflight)
+	go func() {
+		if err := http.ListenAndServe(cfg.ProbeAddress, nil); err != nil {
+			klog.Errorf("Error serving readiness endpoint: %s", err.Error())
+		}
+	}()
+
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(cm.Host_kubeClient, cfg.ResyncPeriod.Duration)
+	resourcev1alpha1InformerFactory := informers.NewSharedInformerFactory(cm.HCPResource_Client, cfg.ResyncPeriod.Duration)
+
+	controller := controller.NewController(cm.Host_kubeClient, cm.HCPResource_Client, resourcev1alpha1InformerFactory.Hcp().V1alpha1().HCPDeployments(), cfg)
+	if *configFile != "" {
+		go controller.WatchConfig(*configFile, flag.CommandLine, 10*time.Second, stopCh)
+	}
 	kubeInformerFactory.Start(stopCh)
 	resourcev1alpha1InformerFactory.Start(stopCh)
-	if err := controller.Run(2, stopCh); err != nil {
+	if err := controller.Run(cfg.Workers, stopCh); err != nil {
 		klog.Fatalf("Error running controller: %s", err.Error())
 	}
 }